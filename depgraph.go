@@ -0,0 +1,120 @@
+package main
+
+import (
+	"go/build"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// DepGraph is a reverse-dependency ("importer") map for the packages
+// found under a single workspace import path: importers[pkg] is the set
+// of indexed packages that directly import pkg. It's used to expand a
+// single changed package into every package that transitively depends
+// on it, so only the tests that could actually be affected get re-run.
+type DepGraph struct {
+	root string
+
+	mu        sync.Mutex
+	importers map[string]map[string]bool
+	indexed   map[string]bool
+}
+
+// NewDepGraph creates a DepGraph rooted at the given import path. Call
+// Scan to populate it before use.
+func NewDepGraph(root string) *DepGraph {
+	return &DepGraph{
+		root:      root,
+		importers: make(map[string]map[string]bool),
+		indexed:   make(map[string]bool),
+	}
+}
+
+// Scan walks the workspace rooted at g.root and (re)builds the full
+// reverse-dependency map from scratch.
+func (g *DepGraph) Scan() error {
+	root, err := build.Import(g.root, "", build.FindOnly)
+	if err != nil {
+		return err
+	}
+
+	importers := make(map[string]map[string]bool)
+	indexed := make(map[string]bool)
+	err = filepath.Walk(root.Dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return nil
+		}
+		if isIgnoredDir(path) {
+			return filepath.SkipDir
+		}
+		pkg, err := build.ImportDir(path, 0)
+		if err != nil {
+			return nil // not a buildable package
+		}
+		indexed[pkg.ImportPath] = true
+		for _, imported := range pkg.Imports {
+			if importers[imported] == nil {
+				importers[imported] = make(map[string]bool)
+			}
+			importers[imported][pkg.ImportPath] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	g.mu.Lock()
+	g.importers = importers
+	g.indexed = indexed
+	g.mu.Unlock()
+	return nil
+}
+
+// Add (re)indexes a single package's imports, e.g. after a file change
+// or a newly discovered sub-package, without rescanning the whole tree.
+func (g *DepGraph) Add(importPath string) error {
+	pkg, err := build.Import(importPath, "", 0)
+	if err != nil {
+		return err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.indexed[importPath] = true
+	for _, imported := range pkg.Imports {
+		if g.importers[imported] == nil {
+			g.importers[imported] = make(map[string]bool)
+		}
+		g.importers[imported][importPath] = true
+	}
+	return nil
+}
+
+// Affected returns the transitive closure of indexed packages that
+// import pkg, including pkg itself.
+func (g *DepGraph) Affected(pkg string) []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	seen := map[string]bool{pkg: true}
+	queue := []string{pkg}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		for importer := range g.importers[p] {
+			if seen[importer] {
+				continue
+			}
+			seen[importer] = true
+			queue = append(queue, importer)
+		}
+	}
+
+	affected := make([]string, 0, len(seen))
+	for p := range seen {
+		if g.indexed[p] {
+			affected = append(affected, p)
+		}
+	}
+	return affected
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// defaultIgnoredDirs are skipped by the watcher and the dependency
+// scanner on every platform, since they tend to hold huge trees that
+// would otherwise overwhelm both.
+var defaultIgnoredDirs = map[string]bool{
+	".git":         true,
+	"vendor":       true,
+	"node_modules": true,
+}
+
+// isIgnoredDir reports whether a directory encountered while walking
+// the tree should be skipped entirely: dot directories and
+// defaultIgnoredDirs.
+func isIgnoredDir(path string) bool {
+	base := filepath.Base(path)
+	if base != "." && strings.HasPrefix(base, ".") {
+		return true
+	}
+	return defaultIgnoredDirs[base]
+}
+
+// isIgnoredPath reports whether a changed file's path falls under a
+// defaultIgnoredDirs entry, independent of the platform's path
+// separator.
+func isIgnoredPath(name string) bool {
+	for _, part := range strings.Split(filepath.ToSlash(name), "/") {
+		if defaultIgnoredDirs[part] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"go/build"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// Put stdin into cbreak/no-echo mode, returning a func that restores the
+// previous terminal settings. Relies on stty since the tty package isn't
+// available on all platforms this tool targets.
+func enableCbreak() (func(), error) {
+	save := exec.Command("stty", "-g")
+	save.Stdin = os.Stdin
+	saved, err := save.Output()
+	if err != nil {
+		return nil, fmt.Errorf("error reading terminal state: %s", err)
+	}
+	cbreak := exec.Command("stty", "cbreak", "-echo")
+	cbreak.Stdin = os.Stdin
+	if err := cbreak.Run(); err != nil {
+		return nil, fmt.Errorf("error setting cbreak mode: %s", err)
+	}
+	return func() {
+		restore := exec.Command("stty", string(saved))
+		restore.Stdin = os.Stdin
+		restore.Run()
+	}, nil
+}
+
+// Reads single key commands from stdin for the lifetime of Start and
+// dispatches them. Supported keys:
+//
+//	r  re-run tests for the last-affected package
+//	a  run go test ./... across the whole tree
+//	d  relaunch the app under dlv exec --headless for debugging
+//	l  rescan the import path for newly created sub-packages
+//	u  re-run tests with -update
+//	q  shut down cleanly
+func (m *Monitor) watchKeys() {
+	restore, err := enableCbreak()
+	if err != nil {
+		m.Printf("keybindings disabled: %s", err)
+		return
+	}
+	defer restore()
+
+	r := bufio.NewReader(os.Stdin)
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return
+		}
+		switch b {
+		case 'r':
+			m.keyRerunLast()
+		case 'a':
+			m.keyRunAll()
+		case 'd':
+			m.keyDebug()
+		case 'l':
+			m.keyRescan()
+		case 'u':
+			m.keyRunUpdate()
+		case 'q':
+			m.Printf("quit requested")
+			restore()
+			m.stopChild()
+			m.keyCmdLock.Lock()
+			if m.keyCmd != nil {
+				m.keyCmd.Process.Kill()
+				m.keyCmd.Wait()
+			}
+			m.keyCmdLock.Unlock()
+			os.Exit(0)
+		}
+	}
+}
+
+// Re-run tests for the packages affected by the last change event. Runs
+// through the same cancelable path as an ordinary change-triggered test
+// run, so it preempts one already in flight instead of waiting for it.
+func (m *Monitor) keyRerunLast() {
+	m.stateMu.Lock()
+	packages := m.lastTestPackages
+	m.stateMu.Unlock()
+	if len(packages) == 0 {
+		m.Printf("no package to re-run yet")
+		return
+	}
+	m.Test(packages...)
+}
+
+// Run the full test suite for the watched tree.
+func (m *Monitor) keyRunAll() {
+	m.Test(expandPattern(m.ImportPath, "...")...)
+}
+
+// Re-run tests for the last-affected packages with -update, for golden
+// file based tests.
+func (m *Monitor) keyRunUpdate() {
+	m.stateMu.Lock()
+	importPaths := m.lastTestPackages
+	m.stateMu.Unlock()
+	if len(importPaths) == 0 {
+		importPaths = expandPattern(m.ImportPath, "...")
+	}
+	m.TestUpdate(importPaths...)
+}
+
+// Relaunch the app under dlv exec --headless so a debugger can attach,
+// killing any previous debug session first.
+func (m *Monitor) keyDebug() {
+	bin, err := m.RestartBin()
+	if err != nil {
+		log.Printf("error finding binary: %s", err)
+		return
+	}
+
+	m.keyCmdLock.Lock()
+	defer m.keyCmdLock.Unlock()
+	if m.keyCmd != nil {
+		m.keyCmd.Process.Kill()
+		m.keyCmd.Wait()
+		m.keyCmd = nil
+	}
+
+	args := []string{"exec", "--headless", "--listen=:2345", "--api-version=2", bin}
+	if len(m.Args) > 1 {
+		args = append(args, "--")
+		args = append(args, m.Args[1:]...)
+	}
+	cmd := exec.Command("dlv", args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		log.Printf("error starting dlv: %s", err)
+		return
+	}
+	m.Printf("debugging %s, attach with: dlv connect :2345", bin)
+	m.keyCmd = cmd
+	go cmd.Wait()
+}
+
+// Rescan the import path for newly created sub-packages and start
+// watching them.
+func (m *Monitor) keyRescan() {
+	m.Printf("rescanning %s for new packages", m.ImportPath)
+	pkg, err := build.Import(m.ImportPath, "", build.FindOnly)
+	if err != nil {
+		log.Printf("error rescanning packages: %s", err)
+		return
+	}
+	filepath.Walk(pkg.Dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return nil
+		}
+		if filepath.Base(path)[0] == '.' {
+			return filepath.SkipDir
+		}
+		sub, err := build.ImportDir(path, 0)
+		if err != nil {
+			return nil
+		}
+		go m.Watcher.WatchImportPath(sub.ImportPath, true)
+		return nil
+	})
+}
@@ -19,23 +19,22 @@
 //
 // TODO:
 //     - Colors.
-//     - Intelligent test execution.
 //     - Intelligent screen clearing while working on tests.
 package main
 
 import (
+	"context"
 	"flag"
-	"fmt"
 	"github.com/daaku/go.pkgwatcher"
 	"github.com/daaku/go.tool"
 	"log"
-	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
 	"runtime"
 	"strings"
 	"sync"
+	"time"
 )
 
 // The main Monitor instance.
@@ -44,15 +43,28 @@ type Monitor struct {
 	RunTests         bool
 	Verbose          bool
 	ClearScreen      bool
+	Scope            string
+	Debounce         time.Duration
+	ShutdownTimeout  time.Duration
+	Notifiers        []Notifier
 	IncludePatternRe *regexp.Regexp
 	Watcher          *pkgwatcher.Watcher
 	ImportPath       string
 	Args             []string
 	CustomRestart    string
+	eventCh          chan *pkgwatcher.Event
 	eventLock        sync.Locker
-	lastCommandError *tool.CommandError
-	lastTestFailed   bool
-	process          *os.Process
+	stateMu          sync.Mutex
+	lastTestPackages []string
+	lastFailedTests  map[string]bool
+	child            *exec.Cmd
+	keyCmdLock       sync.Mutex
+	keyCmd           *exec.Cmd
+	depGraph         *DepGraph
+	scopeInclude     map[string]bool
+	scopeExclude     map[string]bool
+	runMu            sync.Mutex
+	runCancel        context.CancelFunc
 }
 
 // Printf for verbose mode.
@@ -65,65 +77,13 @@ func (m *Monitor) Printf(format string, v ...interface{}) {
 // Clear the screen if configured to do so.
 func (m *Monitor) Clear() {
 	if m.ClearScreen {
-		fmt.Printf("\033[2J")
-		fmt.Printf("\033[H")
+		clearScreen()
 	}
 }
 
-// Checks and also updates the last command.
-func (m *Monitor) isSameAsLastCommandError(err error) bool {
-	commandError, ok := err.(*tool.CommandError)
-	if !ok {
-		return false
-	}
-	last := m.lastCommandError
-	if last != nil && string(last.StdErr()) == string(commandError.StdErr()) {
-		return true
-	}
-	m.lastCommandError = commandError
-	return false
-}
-
-// Restart already installed binary.
-func (m *Monitor) Restart() {
-	m.Printf("restart requested")
-	bin, err := m.RestartBin()
-	if err != nil {
-		log.Printf("error finding binary: %s", err)
-		return
-	}
-	m.Clear()
-	if m.process != nil {
-		m.process.Kill()
-		m.process.Wait()
-		m.process = nil
-	}
-	m.process, err = os.StartProcess(bin, m.Args, &os.ProcAttr{
-		Files: []*os.File{
-			nil,
-			os.Stdout,
-			os.Stderr,
-		},
-	})
-	if err != nil {
-		log.Printf("Failed to run command %s: %s", bin, err)
-	}
-}
-
-func (m *Monitor) RestartBin() (string, error) {
-	p := m.CustomRestart
-	if p == "" {
-		p = filepath.Base(m.ImportPath)
-	}
-	bin, err := exec.LookPath(p)
-	if err != nil {
-		return "", fmt.Errorf("error finding binary: %s", err)
-	}
-	return bin, nil
-}
-
 // Install package(s). Returns true if packages were successfully installed.
 func (m *Monitor) Install(importPath string) bool {
+	m.fanOut(func(n Notifier) { n.OnBuildStart() })
 	options := tool.Options{
 		ImportPaths: []string{importPath},
 		Verbose:     true,
@@ -131,32 +91,96 @@ func (m *Monitor) Install(importPath string) bool {
 	affected, err := options.Command("install")
 	if err != nil {
 		m.Printf("Install Error: %v", err)
+		m.fanOut(func(n Notifier) { n.OnBuildFail(err) })
 		return false
 	}
 	m.Printf("Install Affected: %v", affected)
 	if len(affected) == 0 {
 		return false
 	}
+	m.fanOut(func(n Notifier) { n.OnBuildOk() })
 	return true
 }
 
-// Test a package.
-func (m *Monitor) Test(importPath string) {
-	options := tool.Options{
-		ImportPaths: []string{importPath},
-	}
-	_, err := options.Command("test")
+// Test the given packages, printing a compact per-package/per-test
+// summary and surfacing output only for failures, deduped against the
+// last run. Cancels any test run already in flight.
+func (m *Monitor) Test(importPaths ...string) {
+	m.test(false, importPaths...)
+}
+
+// TestUpdate re-runs the given packages with -update, through the same
+// cancelable, JSON-parsed run path as Test.
+func (m *Monitor) TestUpdate(importPaths ...string) {
+	m.test(true, importPaths...)
+}
+
+func (m *Monitor) test(update bool, importPaths ...string) {
+	ctx := m.newRunContext()
+	run, err := runTestsJSON(ctx, importPaths, m.Verbose, update)
 	if err != nil {
-		if !m.isSameAsLastCommandError(err) {
-			log.Print(err)
+		if ctx.Err() != nil {
+			m.Printf("test run for %v canceled", importPaths)
+			return
 		}
-		m.lastTestFailed = true
-	} else {
-		if m.lastTestFailed {
-			log.Print("test passed")
-			m.lastTestFailed = false
+		if _, ok := err.(*exec.ExitError); !ok {
+			log.Printf("error running tests: %s", err)
+			return
+		}
+	}
+	m.stateMu.Lock()
+	run.PrintSummary(m.lastFailedTests)
+	m.lastFailedTests = run.FailedTestKeys()
+	m.stateMu.Unlock()
+
+	failedPackages := run.Failed()
+	if len(failedPackages) == 0 {
+		m.fanOut(func(n Notifier) { n.OnTestPass() })
+		return
+	}
+	for _, pkg := range failedPackages {
+		var tests []string
+		for name, t := range run.Packages[pkg].Tests {
+			if name != "" && t.Failed() {
+				tests = append(tests, name)
+			}
 		}
+		m.fanOut(func(n Notifier) { n.OnTestFail(pkg, tests) })
+	}
+}
+
+// newRunContext cancels whatever test run is currently in flight and
+// returns a context for the new one, so a fresh change event always
+// wins over stale work.
+func (m *Monitor) newRunContext() context.Context {
+	m.runMu.Lock()
+	defer m.runMu.Unlock()
+	if m.runCancel != nil {
+		m.runCancel()
 	}
+	ctx, cancel := context.WithCancel(context.Background())
+	m.runCancel = cancel
+	return ctx
+}
+
+// scopedPackages expands pkg to every package that transitively depends
+// on it via the DepGraph, restricted to the -scope patterns, if any.
+func (m *Monitor) scopedPackages(pkg string) []string {
+	affected := m.depGraph.Affected(pkg)
+	if len(m.scopeInclude) == 0 && len(m.scopeExclude) == 0 {
+		return affected
+	}
+	var scoped []string
+	for _, p := range affected {
+		if len(m.scopeInclude) > 0 && !m.scopeInclude[p] {
+			continue
+		}
+		if m.scopeExclude[p] {
+			continue
+		}
+		scoped = append(scoped, p)
+	}
+	return scoped
 }
 
 // Check if a file change should be ignored.
@@ -164,7 +188,10 @@ func (m *Monitor) ShouldIgnore(name string) bool {
 	if filepath.Base(name)[0] == '.' {
 		m.Printf("Ignored changed dot file %s", name)
 		return true
-	} else if m.IncludePatternRe.Match([]byte(name)) {
+	} else if isIgnoredPath(name) {
+		m.Printf("Ignored changed file %s under an ignored directory", name)
+		return true
+	} else if m.IncludePatternRe.MatchString(filepath.ToSlash(name)) {
 		return false
 	}
 
@@ -172,16 +199,37 @@ func (m *Monitor) ShouldIgnore(name string) bool {
 	return true
 }
 
-// Watcher event handler.
-func (m *Monitor) Event(ev *pkgwatcher.Event) {
-	if m.ShouldIgnore(ev.Name) {
+// handleBatch processes one debounced batch of change events as a
+// single install/test/restart cycle, so a burst of saves only triggers
+// one install and one restart.
+func (m *Monitor) handleBatch(events []*pkgwatcher.Event) {
+	changedTestFile := false
+	pkgSet := make(map[string]bool)
+	for _, ev := range events {
+		if m.ShouldIgnore(ev.Name) {
+			continue
+		}
+		go m.Watcher.WatchImportPath(ev.Package.ImportPath, true)
+		if err := m.depGraph.Add(ev.Package.ImportPath); err != nil {
+			m.Printf("error updating dep graph for %s: %s", ev.Package.ImportPath, err)
+		}
+		pkgSet[ev.Package.ImportPath] = true
+		if strings.Contains(ev.Name, "_test.go") {
+			changedTestFile = true
+		}
+	}
+	if len(pkgSet) == 0 {
 		return
 	}
 
-	go m.Watcher.WatchImportPath(ev.Package.ImportPath, true)
+	m.Printf("Change triggered restart: %v", events)
+
+	// Install and restart are serialized against concurrent batches, since
+	// they mutate m.child / relaunch the process; Test is deliberately
+	// called outside this lock below so a newer batch's call preempts an
+	// older batch's in-flight run via newRunContext instead of queuing
+	// behind it.
 	m.eventLock.Lock()
-	defer m.eventLock.Unlock()
-	m.Printf("Change triggered restart: %+v", ev)
 	m.Printf("Installing all packages.")
 	did := m.Install("all")
 	if did {
@@ -189,24 +237,77 @@ func (m *Monitor) Event(ev *pkgwatcher.Event) {
 	} else {
 		m.Printf("Skipping because did not install anything.")
 	}
+	m.eventLock.Unlock()
+
 	// force showing errors for test changes
-	if strings.Contains(ev.Name, "_test.go") {
-		m.lastCommandError = nil
+	if changedTestFile {
+		m.stateMu.Lock()
+		m.lastFailedTests = nil
+		m.stateMu.Unlock()
 	}
 	if m.RunTests {
-		m.Printf("Testing %s.", ev.Package.ImportPath)
-		m.Test(ev.Package.ImportPath)
+		affectedSet := make(map[string]bool)
+		for pkg := range pkgSet {
+			for _, p := range m.scopedPackages(pkg) {
+				affectedSet[p] = true
+			}
+		}
+		affected := make([]string, 0, len(affectedSet))
+		for p := range affectedSet {
+			affected = append(affected, p)
+		}
+		if len(affected) == 0 {
+			m.Printf("No packages affected by %v, skipping tests.", events)
+			return
+		}
+		m.Printf("Testing %v.", affected)
+		m.stateMu.Lock()
+		m.lastTestPackages = affected
+		m.stateMu.Unlock()
+		m.Test(affected...)
+	}
+}
+
+// worker coalesces bursts of change events that arrive within the
+// debounce window (editors often emit several events per save) into one
+// batch, then hands each batch off to its own goroutine so a later batch
+// can preempt an earlier one's in-flight test run instead of queuing
+// behind the whole install/test/restart cycle.
+func (m *Monitor) worker() {
+	var pending []*pkgwatcher.Event
+	var timer *time.Timer
+	for {
+		if timer == nil {
+			pending = append(pending, <-m.eventCh)
+			timer = time.NewTimer(m.Debounce)
+			continue
+		}
+		select {
+		case ev := <-m.eventCh:
+			pending = append(pending, ev)
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(m.Debounce)
+		case <-timer.C:
+			batch := pending
+			pending = nil
+			timer = nil
+			go m.handleBatch(batch)
+		}
 	}
 }
 
 // Start the main blocking Monitor loop.
 func (m *Monitor) Start() {
 	m.Restart()
+	go m.watchKeys()
+	go m.worker()
 	for {
 		m.Printf("Main loop iteration.")
 		select {
 		case ev := <-m.Watcher.Event:
-			go m.Event(ev)
+			m.eventCh <- ev
 		case err := <-m.Watcher.Error:
 			log.Println("watcher error:", err)
 		}
@@ -217,6 +318,7 @@ func main() {
 	runtime.GOMAXPROCS(runtime.NumCPU() + 1)
 	monitor := &Monitor{
 		eventLock: new(sync.Mutex),
+		eventCh:   make(chan *pkgwatcher.Event, 16),
 	}
 	flag.StringVar(&monitor.IncludePattern, "f", ".",
 		"regexp pattern to match file names against to watch for changes")
@@ -225,14 +327,30 @@ func main() {
 	flag.BoolVar(&monitor.ClearScreen, "c", true, "clear screen on restart")
 	flag.StringVar(
 		&monitor.CustomRestart, "restart-command", "", "custom restart command")
+	flag.StringVar(&monitor.Scope, "scope", "",
+		"restrict intelligent test selection to these go test style patterns, "+
+			"e.g. \"./... -./internal/...\"")
+	flag.DurationVar(&monitor.Debounce, "debounce", 300*time.Millisecond,
+		"coalesce change events that arrive within this window into one cycle")
+	flag.DurationVar(&monitor.ShutdownTimeout, "shutdown-timeout", 5*time.Second,
+		"time to wait for the child process to exit after SIGINT/SIGTERM before SIGKILL")
+	notify := flag.String("notify", "",
+		"comma separated notifiers to enable, e.g. "+
+			"\"desktop,webhook:https://example.com/hook,exec:./scripts/notify.sh\"")
 	flag.Parse()
 
+	monitor.Notifiers = parseNotifiers(*notify)
 	monitor.ImportPath = flag.Arg(0)
 	monitor.Args = append(
 		[]string{filepath.Base(monitor.ImportPath)},
 		flag.Args()[1:flag.NArg()]...)
 
-	re, err := regexp.Compile(monitor.IncludePattern)
+	pattern := monitor.IncludePattern
+	if runtime.GOOS == "windows" {
+		// match case-insensitively, since Windows paths are too
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
 	if err != nil {
 		log.Fatalf("failed to compile given regexp pattern: %s", monitor.IncludePattern)
 	}
@@ -244,5 +362,12 @@ func main() {
 	}
 	monitor.Watcher = watcher
 
+	monitor.depGraph = NewDepGraph(monitor.ImportPath)
+	if err := monitor.depGraph.Scan(); err != nil {
+		log.Printf("error building initial dependency graph: %s", err)
+	}
+	monitor.scopeInclude, monitor.scopeExclude =
+		expandScope(monitor.ImportPath, monitor.Scope)
+
 	monitor.Start()
 }
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Notifier receives lifecycle events from the install/test/restart
+// cycle, so external systems (desktop notifications, webhooks, CI
+// hooks) can react without Monitor knowing anything about them.
+type Notifier interface {
+	OnBuildStart()
+	OnBuildFail(err error)
+	OnBuildOk()
+	OnTestFail(pkg string, tests []string)
+	OnTestPass()
+	OnRestart(pid int)
+}
+
+// parseNotifiers parses a -notify flag value like
+// "desktop,webhook:https://example.com/hook,exec:./scripts/notify.sh"
+// into the corresponding Notifier implementations.
+func parseNotifiers(spec string) []Notifier {
+	var notifiers []Notifier
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		kind := part
+		arg := ""
+		if i := strings.Index(part, ":"); i >= 0 {
+			kind = part[:i]
+			arg = part[i+1:]
+		}
+		switch kind {
+		case "desktop":
+			notifiers = append(notifiers, &desktopNotifier{})
+		case "webhook":
+			notifiers = append(notifiers, &webhookNotifier{URL: arg})
+		case "exec":
+			notifiers = append(notifiers, &execNotifier{Command: arg})
+		default:
+			log.Printf("unknown -notify entry %q", part)
+		}
+	}
+	return notifiers
+}
+
+// fanOut runs fn against every configured notifier, each in its own
+// goroutine, so a slow or unreachable notifier (e.g. a stalled webhook)
+// can't stall the install/test/restart cycle it's reporting on.
+func (m *Monitor) fanOut(fn func(Notifier)) {
+	for _, n := range m.Notifiers {
+		go fn(n)
+	}
+}
+
+// desktopNotifier shows native desktop notifications via notify-send
+// (Linux), osascript (macOS) or msg (Windows).
+type desktopNotifier struct{}
+
+func (n *desktopNotifier) send(title, body string) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		script := fmt.Sprintf("display notification %q with title %q", body, title)
+		cmd = exec.Command("osascript", "-e", script)
+	case "windows":
+		cmd = exec.Command("msg", "*", title+": "+body)
+	default:
+		cmd = exec.Command("notify-send", title, body)
+	}
+	if err := cmd.Run(); err != nil {
+		log.Printf("desktop notify error: %s", err)
+	}
+}
+
+func (n *desktopNotifier) OnBuildStart() {}
+func (n *desktopNotifier) OnBuildFail(err error) {
+	n.send("go.onchange", "build failed: "+err.Error())
+}
+func (n *desktopNotifier) OnBuildOk() {}
+func (n *desktopNotifier) OnTestFail(pkg string, tests []string) {
+	n.send("go.onchange", fmt.Sprintf("%s: %s failed", pkg, strings.Join(tests, ", ")))
+}
+func (n *desktopNotifier) OnTestPass()   { n.send("go.onchange", "tests passed") }
+func (n *desktopNotifier) OnRestart(int) {}
+
+// webhookNotifier posts a JSON payload describing the event to a
+// configured URL.
+type webhookNotifier struct {
+	URL string
+}
+
+type webhookPayload struct {
+	Event string   `json:"event"`
+	Pkg   string   `json:"pkg,omitempty"`
+	Tests []string `json:"tests,omitempty"`
+	Error string   `json:"error,omitempty"`
+	Pid   int      `json:"pid,omitempty"`
+}
+
+// webhookClient bounds how long a slow or unreachable endpoint can hold
+// up a notification; http.DefaultClient has no timeout.
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+func (n *webhookNotifier) post(p webhookPayload) {
+	body, err := json.Marshal(p)
+	if err != nil {
+		return
+	}
+	resp, err := webhookClient.Post(n.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("webhook notify error: %s", err)
+		return
+	}
+	resp.Body.Close()
+}
+
+func (n *webhookNotifier) OnBuildStart() { n.post(webhookPayload{Event: "build_start"}) }
+func (n *webhookNotifier) OnBuildFail(err error) {
+	n.post(webhookPayload{Event: "build_fail", Error: err.Error()})
+}
+func (n *webhookNotifier) OnBuildOk() { n.post(webhookPayload{Event: "build_ok"}) }
+func (n *webhookNotifier) OnTestFail(pkg string, tests []string) {
+	n.post(webhookPayload{Event: "test_fail", Pkg: pkg, Tests: tests})
+}
+func (n *webhookNotifier) OnTestPass()       { n.post(webhookPayload{Event: "test_pass"}) }
+func (n *webhookNotifier) OnRestart(pid int) { n.post(webhookPayload{Event: "restart", Pid: pid}) }
+
+// execNotifier runs a user-supplied shell command for every event,
+// exporting the event's fields as environment variables.
+type execNotifier struct {
+	Command string
+}
+
+func (n *execNotifier) run(event, pkg, status, stderr string) {
+	if n.Command == "" {
+		return
+	}
+	cmd := exec.Command("sh", "-c", n.Command)
+	cmd.Env = append(os.Environ(),
+		"ONCHANGE_EVENT="+event,
+		"ONCHANGE_PKG="+pkg,
+		"ONCHANGE_STATUS="+status,
+		"ONCHANGE_STDERR="+stderr,
+	)
+	if err := cmd.Run(); err != nil {
+		log.Printf("exec notify error: %s", err)
+	}
+}
+
+func (n *execNotifier) OnBuildStart()         { n.run("build", "", "start", "") }
+func (n *execNotifier) OnBuildFail(err error) { n.run("build", "", "fail", err.Error()) }
+func (n *execNotifier) OnBuildOk()            { n.run("build", "", "ok", "") }
+func (n *execNotifier) OnTestFail(pkg string, tests []string) {
+	n.run("test", pkg, "fail", strings.Join(tests, ","))
+}
+func (n *execNotifier) OnTestPass()       { n.run("test", "", "pass", "") }
+func (n *execNotifier) OnRestart(pid int) { n.run("restart", "", fmt.Sprintf("%d", pid), "") }
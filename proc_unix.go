@@ -0,0 +1,36 @@
+//go:build !windows
+
+package main
+
+import (
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// stopProcess gracefully shuts down cmd: SIGINT, then SIGTERM after
+// timeout, then SIGKILL after another timeout.
+func stopProcess(cmd *exec.Cmd, timeout time.Duration) {
+	if cmd == nil || cmd.Process == nil {
+		return
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	cmd.Process.Signal(syscall.SIGINT)
+	select {
+	case <-done:
+		return
+	case <-time.After(timeout):
+	}
+
+	cmd.Process.Signal(syscall.SIGTERM)
+	select {
+	case <-done:
+		return
+	case <-time.After(timeout):
+	}
+
+	cmd.Process.Kill()
+	<-done
+}
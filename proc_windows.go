@@ -0,0 +1,32 @@
+//go:build windows
+
+package main
+
+import (
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// stopProcess terminates cmd and its full child tree via taskkill.
+// Windows processes don't receive SIGINT/SIGTERM, and a plain
+// Process.Kill only kills cmd itself, leaving any children it spawned
+// running.
+func stopProcess(cmd *exec.Cmd, timeout time.Duration) {
+	if cmd == nil || cmd.Process == nil {
+		return
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	pid := strconv.Itoa(cmd.Process.Pid)
+	exec.Command("taskkill", "/T", "/PID", pid).Run()
+	select {
+	case <-done:
+		return
+	case <-time.After(timeout):
+	}
+
+	exec.Command("taskkill", "/T", "/F", "/PID", pid).Run()
+	<-done
+}
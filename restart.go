@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os/exec"
+	"path/filepath"
+)
+
+// Restart already installed binary, gracefully shutting down any
+// running instance first and piping its output through prefixOutput
+// instead of inheriting stdout/stderr raw.
+func (m *Monitor) Restart() {
+	m.Printf("restart requested")
+	bin, err := m.RestartBin()
+	if err != nil {
+		log.Printf("error finding binary: %s", err)
+		return
+	}
+	m.Clear()
+	m.stopChild()
+
+	cmd := exec.Command(bin, m.Args[1:]...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		log.Printf("error piping stdout for %s: %s", bin, err)
+		return
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		log.Printf("error piping stderr for %s: %s", bin, err)
+		return
+	}
+	if err := cmd.Start(); err != nil {
+		log.Printf("Failed to run command %s: %s", bin, err)
+		return
+	}
+	m.child = cmd
+	go prefixOutput(stdout)
+	go prefixOutput(stderr)
+	m.fanOut(func(n Notifier) { n.OnRestart(cmd.Process.Pid) })
+}
+
+func (m *Monitor) RestartBin() (string, error) {
+	p := m.CustomRestart
+	if p == "" {
+		p = filepath.Base(m.ImportPath)
+	}
+	bin, err := exec.LookPath(p)
+	if err != nil {
+		return "", fmt.Errorf("error finding binary: %s", err)
+	}
+	return bin, nil
+}
+
+// stopChild shuts down the running child process gracefully, using the
+// platform-appropriate mechanism (see proc_unix.go / proc_windows.go).
+func (m *Monitor) stopChild() {
+	if m.child == nil || m.child.Process == nil {
+		return
+	}
+	cmd := m.child
+	m.child = nil
+	stopProcess(cmd, m.ShutdownTimeout)
+}
+
+// prefixOutput copies lines from the child process to stdout, prefixed
+// so it's distinguishable from go.onchange's own log output.
+func prefixOutput(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fmt.Printf("| %s\n", scanner.Text())
+	}
+}
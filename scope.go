@@ -0,0 +1,77 @@
+package main
+
+import (
+	"go/build"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// expandScope expands a whitespace-separated list of go test-style
+// package patterns (e.g. "./... -./internal/...") rooted at root into
+// concrete sets of import paths to include and exclude, mirroring the
+// subset of golang.org/x/tools/go/buildutil.ExpandPatterns semantics
+// that `go test` patterns rely on. An empty scope means "no
+// restriction": every package discovered by the DepGraph is eligible.
+func expandScope(root, scope string) (include, exclude map[string]bool) {
+	include = make(map[string]bool)
+	exclude = make(map[string]bool)
+	for _, pattern := range strings.Fields(scope) {
+		neg := strings.HasPrefix(pattern, "-")
+		if neg {
+			pattern = pattern[1:]
+		}
+		dst := include
+		if neg {
+			dst = exclude
+		}
+		for _, pkg := range expandPattern(root, pattern) {
+			dst[pkg] = true
+		}
+	}
+	return include, exclude
+}
+
+// expandPattern expands a single pattern, handling the "./..." and
+// "pkg/..." recursive forms; anything else is treated as a literal
+// import path (relative to root when it doesn't contain a slash).
+func expandPattern(root, pattern string) []string {
+	pattern = strings.TrimPrefix(pattern, "./")
+	if pattern != "..." && !strings.HasSuffix(pattern, "/...") {
+		if pattern == "" {
+			return []string{root}
+		}
+		if !strings.Contains(pattern, "/") {
+			pattern = root + "/" + pattern
+		}
+		return []string{pattern}
+	}
+
+	sub := strings.TrimSuffix(strings.TrimSuffix(pattern, "..."), "/")
+	importPath := root
+	if sub != "" {
+		importPath = root + "/" + sub
+	}
+
+	dir, err := build.Import(importPath, "", build.FindOnly)
+	if err != nil {
+		return nil
+	}
+
+	var pkgs []string
+	filepath.Walk(dir.Dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return nil
+		}
+		if isIgnoredDir(path) {
+			return filepath.SkipDir
+		}
+		pkg, err := build.ImportDir(path, 0)
+		if err != nil {
+			return nil
+		}
+		pkgs = append(pkgs, pkg.ImportPath)
+		return nil
+	})
+	return pkgs
+}
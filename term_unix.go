@@ -0,0 +1,10 @@
+//go:build !windows
+
+package main
+
+import "fmt"
+
+// clearScreen clears the terminal using ANSI escape codes.
+func clearScreen() {
+	fmt.Print("\033[2J\033[H")
+}
@@ -0,0 +1,59 @@
+//go:build windows
+
+package main
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32                        = syscall.NewLazyDLL("kernel32.dll")
+	procGetStdHandle                = kernel32.NewProc("GetStdHandle")
+	procGetConsoleScreenBufferInfo  = kernel32.NewProc("GetConsoleScreenBufferInfo")
+	procFillConsoleOutputCharacterW = kernel32.NewProc("FillConsoleOutputCharacterW")
+	procFillConsoleOutputAttribute  = kernel32.NewProc("FillConsoleOutputAttribute")
+	procSetConsoleCursorPosition    = kernel32.NewProc("SetConsoleCursorPosition")
+)
+
+const stdOutputHandle = -11
+
+type coord struct {
+	X, Y int16
+}
+
+type smallRect struct {
+	Left, Top, Right, Bottom int16
+}
+
+type consoleScreenBufferInfo struct {
+	Size              coord
+	CursorPosition    coord
+	Attributes        uint16
+	Window            smallRect
+	MaximumWindowSize coord
+}
+
+func coordToUintptr(c coord) uintptr {
+	return uintptr(uint32(uint16(c.X)) | uint32(uint16(c.Y))<<16)
+}
+
+// clearScreen clears the terminal using the Win32 console API, since
+// older cmd.exe versions don't reliably support ANSI escape codes.
+func clearScreen() {
+	var stdOutput int32 = stdOutputHandle
+	handle, _, _ := procGetStdHandle.Call(uintptr(uint32(stdOutput)))
+
+	var info consoleScreenBufferInfo
+	procGetConsoleScreenBufferInfo.Call(handle, uintptr(unsafe.Pointer(&info)))
+
+	cellCount := uintptr(info.Size.X) * uintptr(info.Size.Y)
+	origin := coordToUintptr(coord{0, 0})
+
+	var written uint32
+	procFillConsoleOutputCharacterW.Call(
+		handle, uintptr(' '), cellCount, origin, uintptr(unsafe.Pointer(&written)))
+	procFillConsoleOutputAttribute.Call(
+		handle, uintptr(info.Attributes), cellCount, origin, uintptr(unsafe.Pointer(&written)))
+	procSetConsoleCursorPosition.Call(handle, origin)
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+)
+
+// A single test2json event, as emitted by `go test -json`.
+type testEvent struct {
+	Action  string
+	Package string
+	Test    string
+	Output  string
+	Elapsed float64
+}
+
+// Per-test state accumulated across its events.
+type TestState struct {
+	Action  string
+	Elapsed float64
+	Output  []string
+}
+
+// Failed reports whether the test (or package, for the "" test name)
+// ended in a failure.
+func (s *TestState) Failed() bool {
+	return s.Action == "fail"
+}
+
+// Per-package state, including the zero-value test ("") which carries
+// the package-level result.
+type PackageRun struct {
+	ImportPath string
+	Tests      map[string]*TestState
+}
+
+// Package looks up (creating if necessary) the package-level test
+// state, keyed under the empty test name.
+func (p *PackageRun) Package() *TestState {
+	return p.test("")
+}
+
+func (p *PackageRun) test(name string) *TestState {
+	s, ok := p.Tests[name]
+	if !ok {
+		s = &TestState{}
+		p.Tests[name] = s
+	}
+	return s
+}
+
+// TestRun is the accumulated result of one `go test -json` invocation,
+// covering possibly many packages.
+type TestRun struct {
+	Packages map[string]*PackageRun
+}
+
+func newTestRun() *TestRun {
+	return &TestRun{Packages: make(map[string]*PackageRun)}
+}
+
+func (r *TestRun) pkg(importPath string) *PackageRun {
+	p, ok := r.Packages[importPath]
+	if !ok {
+		p = &PackageRun{ImportPath: importPath, Tests: make(map[string]*TestState)}
+		r.Packages[importPath] = p
+	}
+	return p
+}
+
+func (r *TestRun) apply(ev *testEvent) {
+	if ev.Package == "" {
+		return
+	}
+	s := r.pkg(ev.Package).test(ev.Test)
+	switch ev.Action {
+	case "pass", "fail", "skip":
+		s.Action = ev.Action
+		s.Elapsed = ev.Elapsed
+	case "output":
+		s.Output = append(s.Output, ev.Output)
+	}
+}
+
+// Failed returns the import paths of packages that did not pass.
+func (r *TestRun) Failed() []string {
+	var failed []string
+	for importPath, p := range r.Packages {
+		if p.Package().Failed() {
+			failed = append(failed, importPath)
+		}
+	}
+	return failed
+}
+
+// FailedTestKeys returns a stable identifier ("pkg\x00test") for every
+// individual test that failed, for diffing against a previous run.
+func (r *TestRun) FailedTestKeys() map[string]bool {
+	keys := make(map[string]bool)
+	for importPath, p := range r.Packages {
+		for name, t := range p.Tests {
+			if name != "" && t.Failed() {
+				keys[importPath+"\x00"+name] = true
+			}
+		}
+	}
+	return keys
+}
+
+// runTestsJSON runs `go test -json` for the given import paths and
+// parses the resulting event stream into a TestRun. The returned error
+// is the `go test` command's own error, if any; parse failures are
+// logged but otherwise ignored so partial output still gets reported.
+// Canceling ctx kills the in-flight `go test` invocation. update passes
+// -update through to the test binary, for golden file based tests.
+func runTestsJSON(ctx context.Context, importPaths []string, verbose, update bool) (*TestRun, error) {
+	args := []string{"test", "-json"}
+	if verbose {
+		args = append(args, "-v")
+	}
+	if update {
+		args = append(args, "-update")
+	}
+	args = append(args, importPaths...)
+	cmd := exec.CommandContext(ctx, "go", args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stderr = nil
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	run := newTestRun()
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var ev testEvent
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			continue
+		}
+		run.apply(&ev)
+	}
+
+	cmdErr := cmd.Wait()
+	return run, cmdErr
+}
+
+// ANSI color helpers matching Monitor.Clear's use of raw escape codes.
+func green(s string) string { return "\033[32m" + s + "\033[0m" }
+func red(s string) string   { return "\033[31m" + s + "\033[0m" }
+
+// Print a compact colored pass/fail summary, surfacing captured output
+// only for failed tests. seenFailures suppresses output for tests that
+// were already reported as failing in the previous cycle.
+func (r *TestRun) PrintSummary(seenFailures map[string]bool) {
+	for importPath, p := range r.Packages {
+		pkg := p.Package()
+		if pkg.Failed() {
+			fmt.Printf("%s %s %.2fs\n", red("FAIL"), importPath, pkg.Elapsed)
+		} else {
+			fmt.Printf("%s   %s %.2fs\n", green("ok"), importPath, pkg.Elapsed)
+		}
+		failedTests := false
+		for name, t := range p.Tests {
+			if name == "" || !t.Failed() {
+				continue
+			}
+			failedTests = true
+			fmt.Printf("%s %s/%s %.2fs\n", red("FAIL"), importPath, name, t.Elapsed)
+			if seenFailures[importPath+"\x00"+name] {
+				continue
+			}
+			for _, line := range t.Output {
+				fmt.Print(line)
+			}
+		}
+		// Build/compile failures show up as a package-level failure with no
+		// individual failing test, so the package's own Output is all we
+		// have to show the user what actually broke.
+		if pkg.Failed() && !failedTests {
+			for _, line := range pkg.Output {
+				fmt.Print(line)
+			}
+		}
+	}
+}